@@ -0,0 +1,128 @@
+package wkhtmltopdf
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openFDCount returns the number of open file descriptors for the current
+// process, by counting entries under /proc/self/fd. It returns ok=false on
+// platforms (e.g. non-Linux) where that directory doesn't exist, so callers
+// can skip the check gracefully instead of failing.
+func openFDCount() (count int, ok bool) {
+	entries, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	return len(entries), true
+}
+
+// TestCreateContextStress spawns many PDFGenerators concurrently against a
+// fake, slow "wkhtmltopdf" binary, cancels half of them mid-run via a short
+// context timeout, and lets the other half run to completion. It asserts
+// that CreateContext doesn't leak goroutines (e.g. from a process whose
+// Stdin/Stdout pipes are never drained after a cancellation).
+func TestCreateContextStress(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	scriptPath := filepath.Join(t.TempDir(), "fake-wkhtmltopdf.sh")
+	script := "#!/bin/sh\nsleep 0.2\necho fake-pdf\n"
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	before := runtime.NumGoroutine()
+	fdBefore, fdCheckAvailable := openFDCount()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			pdfg := NewPDFPreparer()
+			pdfg.binPath = scriptPath
+			pdfg.AddPage(NewPage("in.html"))
+
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if i%2 == 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+			} else {
+				ctx, cancel = context.WithCancel(context.Background())
+			}
+			defer cancel()
+
+			_ = pdfg.CreateContext(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	// give any just-killed processes a moment to finish unwinding their
+	// goroutines before we sample again
+	time.Sleep(100 * time.Millisecond)
+
+	after := runtime.NumGoroutine()
+	if after > before+5 {
+		t.Errorf("possible goroutine leak: before=%d after=%d", before, after)
+	}
+
+	if fdCheckAvailable {
+		if fdAfter, ok := openFDCount(); ok && fdAfter > fdBefore+5 {
+			t.Errorf("possible file descriptor leak: before=%d after=%d", fdBefore, fdAfter)
+		}
+	}
+}
+
+// TestInitCommandRetriesAfterFailure ensures a failed wkhtmltopdf lookup
+// (e.g. a generator constructed before the binary is installed, or before
+// WKHTMLTOPDF_PATH is set) doesn't poison every later NewPDFGenerator call:
+// unlike a sync.Once, initCommand must retry the lookup as long as GetPath()
+// is still empty.
+func TestInitCommandRetriesAfterFailure(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	origPath := os.Getenv("PATH")
+	origWk := os.Getenv("WKHTMLTOPDF_PATH")
+	defer func() {
+		os.Setenv("PATH", origPath)
+		os.Setenv("WKHTMLTOPDF_PATH", origWk)
+		binPath.Set("")
+	}()
+	binPath.Set("")
+
+	emptyDir := t.TempDir()
+	os.Setenv("PATH", emptyDir)
+	os.Unsetenv("WKHTMLTOPDF_PATH")
+
+	pdfg := &PDFGenerator{}
+	if err := pdfg.initCommand(); err == nil {
+		t.Fatal("expected initCommand to fail when wkhtmltopdf is nowhere to be found")
+	}
+
+	binDir := t.TempDir()
+	scriptPath := filepath.Join(binDir, "wkhtmltopdf")
+	if err := ioutil.WriteFile(scriptPath, []byte("#!/bin/sh\necho fake\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("WKHTMLTOPDF_PATH", binDir)
+
+	if err := pdfg.initCommand(); err != nil {
+		t.Fatalf("initCommand did not retry after the environment was fixed: %v", err)
+	}
+	if pdfg.binPath == "" {
+		t.Error("expected binPath to be set after a successful retry")
+	}
+}
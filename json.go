@@ -0,0 +1,148 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// JSON support for PDFGenerator.
+//
+// globalOptions, outlineOptions, pageOptions, headerAndFooterOptions and
+// tocOptions are plain structs of exported option fields, so they already
+// round-trip through encoding/json without any help: Go promotes the
+// exported fields of anonymous struct fields regardless of whether the
+// field's type name itself is exported, which is how cover, toc and
+// PageOptions pick them up for free. The same is true of cover and toc
+// themselves.
+//
+// Two things don't round-trip for free, and get custom (Un)MarshalJSON
+// below: PDFGenerator.pages, because it is an unexported slice of the page
+// interface (Page or PageReader) and JSON can't pick a concrete type back
+// out of an interface on its own; and PageReader, because its Input is an
+// io.Reader, which encoding/json has no way to serialize.
+
+// pageJSON is the on-the-wire representation of one page interface value,
+// tagged with its concrete type so UnmarshalJSON can reconstruct it.
+type pageJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MarshalJSON implements json.Marshaler. It serializes the full
+// configuration of pdfg (global/outline options, cover, TOC and all pages
+// with their per-page options) so it can be reconstituted elsewhere with
+// NewPDFPreparer followed by UnmarshalJSON.
+func (pdfg *PDFGenerator) MarshalJSON() ([]byte, error) {
+	type alias PDFGenerator // avoid recursing back into MarshalJSON
+
+	pages := make([]pageJSON, 0, len(pdfg.pages))
+	for _, p := range pdfg.pages {
+		var typ string
+		switch p.(type) {
+		case *Page:
+			typ = "page"
+		case *PageReader:
+			typ = "pageReader"
+		default:
+			return nil, fmt.Errorf("wkhtmltopdf: cannot marshal page of type %T", p)
+		}
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, pageJSON{Type: typ, Data: data})
+	}
+
+	return json.Marshal(struct {
+		*alias
+		Pages []pageJSON `json:"pages"`
+	}{
+		alias: (*alias)(pdfg),
+		Pages: pages,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It restores a configuration
+// previously written by MarshalJSON into pdfg, which should have been
+// obtained from NewPDFPreparer. Create/CreateContext still require a path to
+// the wkhtmltopdf binary, so call SetPath (or go through NewPDFGenerator)
+// afterwards if you intend to render, not just inspect, the result.
+func (pdfg *PDFGenerator) UnmarshalJSON(data []byte) error {
+	type alias PDFGenerator
+	aux := struct {
+		*alias
+		Pages []pageJSON `json:"pages"`
+	}{alias: (*alias)(pdfg)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	pdfg.pages = nil
+	for _, pj := range aux.Pages {
+		switch pj.Type {
+		case "page":
+			p := &Page{}
+			if err := json.Unmarshal(pj.Data, p); err != nil {
+				return err
+			}
+			pdfg.pages = append(pdfg.pages, p)
+		case "pageReader":
+			pr := &PageReader{}
+			if err := json.Unmarshal(pj.Data, pr); err != nil {
+				return err
+			}
+			pdfg.pages = append(pdfg.pages, pr)
+		default:
+			return fmt.Errorf("wkhtmltopdf: unknown page type %q", pj.Type)
+		}
+	}
+	return nil
+}
+
+// pageReaderJSON is the on-the-wire representation of a PageReader: its
+// buffered input, base64-encoded, alongside its page options.
+type pageReaderJSON struct {
+	PageOptions
+	InputBase64 string `json:"inputBase64"`
+}
+
+// MarshalJSON implements json.Marshaler. Since Input is a generic io.Reader,
+// it is read into memory and base64-encoded; pr.Input is replaced with a
+// reader over those same bytes so pr stays usable for Create afterwards. If
+// you need the original reader back as-is, use a Page with a file input
+// instead of a PageReader.
+func (pr *PageReader) MarshalJSON() ([]byte, error) {
+	buf, err := ioutil.ReadAll(pr.Input)
+	if err != nil {
+		return nil, err
+	}
+	pr.Input = bytes.NewReader(buf)
+
+	return json.Marshal(pageReaderJSON{
+		PageOptions: pr.PageOptions,
+		InputBase64: base64.StdEncoding.EncodeToString(buf),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the base64 payload
+// written by MarshalJSON back into an in-memory reader.
+func (pr *PageReader) UnmarshalJSON(data []byte) error {
+	var aux pageReaderJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(aux.InputBase64)
+	if err != nil {
+		return err
+	}
+
+	pr.PageOptions = aux.PageOptions
+	pr.Input = bytes.NewReader(buf)
+	return nil
+}
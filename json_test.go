@@ -0,0 +1,34 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPDFGeneratorJSONRoundTrip(t *testing.T) {
+	pdfg := NewPDFPreparer()
+	pdfg.OutputFile = "out.pdf"
+	pdfg.Cover.Input = "cover.html"
+	pdfg.TOC.Include = true
+
+	pdfg.AddPage(NewPage("page1.html"))
+	pdfg.AddPage(NewPageReader(bytes.NewReader([]byte("<html><body>hi</body></html>"))))
+
+	data, err := json.Marshal(pdfg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	got := NewPDFPreparer()
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	wantArgs := strings.Join(pdfg.Args(), " ")
+	gotArgs := strings.Join(got.Args(), " ")
+	if wantArgs != gotArgs {
+		t.Errorf("Args() mismatch after JSON round-trip:\nwant: %s\ngot:  %s", wantArgs, gotArgs)
+	}
+}
@@ -0,0 +1,278 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// pdfTrailer holds the parts of a classic (non cross-reference-stream) PDF
+// trailer that the post-processors in this package need.
+type pdfTrailer struct {
+	size      int
+	rootNum   int
+	startxref int
+}
+
+var (
+	reStartXref   = regexp.MustCompile(`(?s)startxref\s*(\d+)\s*%%EOF\s*$`)
+	reTrailerDict = regexp.MustCompile(`(?s)trailer\s*<<(.*?)>>\s*(?:startxref|$)`)
+	reRootEntry   = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	reSizeEntry   = regexp.MustCompile(`/Size\s+(\d+)`)
+	reObjHead     = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	reStreamKw    = regexp.MustCompile(`\bstream\b`)
+	reEndStreamKw = regexp.MustCompile(`\bendstream\b`)
+	reEndObjKw    = regexp.MustCompile(`\bendobj\b`)
+	reLengthEntry = regexp.MustCompile(`/Length\s+(\d+)\b(\s+\d+\s+R)?`)
+)
+
+// objRange is the byte range of one indirect object, as found by
+// findObjectBounds: full is the entire "N G obj ... endobj" block, body is
+// just the content between the "obj" and "endobj" keywords.
+type objRange struct {
+	full [2]int
+	body [2]int
+}
+
+// findObjectBounds scans data once, left to right, and returns the byte
+// range of every top-level indirect object. Unlike a plain regexp search for
+// "obj"/"endobj" over the whole file, it treats the bytes between a
+// "stream" keyword and its matching "endstream" as opaque binary and never
+// looks for object boundaries inside them (preferring the dict's /Length
+// when present, since that's exact; falling back to the literal "endstream"
+// keyword otherwise). This matters because real wkhtmltopdf output routinely
+// embeds binary font streams (FontFile/FontFile2), and binary data can
+// easily contain byte sequences that look like "12 0 obj" or "endobj".
+func findObjectBounds(data []byte) map[int]objRange {
+	bounds := map[int]objRange{}
+	pos := 0
+	for pos < len(data) {
+		hm := reObjHead.FindSubmatchIndex(data[pos:])
+		if hm == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+hm[2] : pos+hm[3]]))
+		fullStart := pos + hm[0]
+		headerEnd := pos + hm[1]
+
+		cursor := headerEnd
+		sm := reStreamKw.FindIndex(data[cursor:])
+		// A "stream" keyword only belongs to the current object if it
+		// appears before the current object's own "endobj" - otherwise
+		// it's the next object's stream, and this object has no stream
+		// of its own (e.g. a dictionary-only object sandwiched between
+		// two stream objects).
+		if em0 := reEndObjKw.FindIndex(data[cursor:]); em0 != nil && (sm == nil || em0[0] < sm[0]) {
+			sm = nil
+		}
+		if sm != nil {
+			dictPart := data[cursor : cursor+sm[0]]
+			bodyStart := cursor + sm[1]
+			if bodyStart < len(data) && data[bodyStart] == '\r' {
+				bodyStart++
+			}
+			if bodyStart < len(data) && data[bodyStart] == '\n' {
+				bodyStart++
+			}
+
+			streamEnd := -1
+			// an indirect "/Length N 0 R" names an object, not a byte count
+			if lm := reLengthEntry.FindSubmatch(dictPart); lm != nil && len(lm[2]) == 0 {
+				if n, err := strconv.Atoi(string(lm[1])); err == nil && bodyStart+n <= len(data) {
+					streamEnd = bodyStart + n
+				}
+			}
+			if streamEnd < 0 {
+				if em := reEndStreamKw.FindIndex(data[bodyStart:]); em != nil {
+					streamEnd = bodyStart + em[0]
+				}
+			}
+			if streamEnd >= 0 {
+				cursor = streamEnd
+				if em := reEndStreamKw.FindIndex(data[cursor:]); em != nil {
+					cursor += em[1]
+				}
+			}
+		}
+
+		em := reEndObjKw.FindIndex(data[cursor:])
+		if em == nil {
+			// malformed/truncated object; skip past its header and keep
+			// scanning rather than looping forever.
+			pos = headerEnd
+			continue
+		}
+		bodyEnd := cursor + em[0]
+		fullEnd := cursor + em[1]
+
+		bounds[num] = objRange{full: [2]int{fullStart, fullEnd}, body: [2]int{headerEnd, bodyEnd}}
+		pos = fullEnd
+	}
+	return bounds
+}
+
+// parseTrailer extracts the trailer of a classic PDF, i.e. one that ends in
+// a plain xref/trailer section rather than a cross-reference stream. This is
+// what wkhtmltopdf (via Qt WebKit) produces.
+func parseTrailer(data []byte) (*pdfTrailer, error) {
+	xm := reStartXref.FindSubmatch(data)
+	if xm == nil {
+		return nil, fmt.Errorf("wkhtmltopdf: could not locate startxref; cross-reference streams are not supported")
+	}
+	startxref, err := strconv.Atoi(string(xm[1]))
+	if err != nil {
+		return nil, err
+	}
+	if startxref < 0 || startxref > len(data) {
+		return nil, fmt.Errorf("wkhtmltopdf: startxref offset %d is out of range", startxref)
+	}
+
+	// Bound the trailer search to the bytes at or after the most recent
+	// xref section (the one startxref actually points to): a document
+	// that has already been through one patchDocument call has an earlier,
+	// stale "trailer<<...>>" block too, and a plain FindSubmatch over the
+	// whole buffer would return that one instead of the current trailer.
+	tm := reTrailerDict.FindSubmatch(data[startxref:])
+	if tm == nil {
+		return nil, fmt.Errorf("wkhtmltopdf: could not locate trailer dictionary")
+	}
+	dict := tm[1]
+
+	rm := reRootEntry.FindSubmatch(dict)
+	if rm == nil {
+		return nil, fmt.Errorf("wkhtmltopdf: trailer has no /Root entry")
+	}
+	rootNum, _ := strconv.Atoi(string(rm[1]))
+
+	size := 0
+	if sm := reSizeEntry.FindSubmatch(dict); sm != nil {
+		size, _ = strconv.Atoi(string(sm[1]))
+	}
+
+	return &pdfTrailer{size: size, rootNum: rootNum, startxref: startxref}, nil
+}
+
+// findObject returns the byte range of object num's "num gen obj ... endobj"
+// block, including the obj/endobj keywords.
+func findObject(data []byte, num int) (start, end int, err error) {
+	r, ok := findObjectBounds(data)[num]
+	if !ok {
+		return 0, 0, fmt.Errorf("wkhtmltopdf: object %d not found", num)
+	}
+	return r.full[0], r.full[1], nil
+}
+
+// mergeDictEntries adds or overwrites entries in the dictionary of obj (the
+// byte range returned by findObject) and returns the patched object body
+// ("<< ... >>", without the obj/endobj wrapper).
+func mergeDictEntries(obj []byte, entries map[string]string) (string, error) {
+	dictStart := bytes.Index(obj, []byte("<<"))
+	dictEnd := bytes.LastIndex(obj, []byte(">>"))
+	if dictStart < 0 || dictEnd < 0 || dictEnd < dictStart {
+		return "", fmt.Errorf("wkhtmltopdf: object has no dictionary")
+	}
+	dict := string(obj[dictStart+2 : dictEnd])
+
+	for key, value := range entries {
+		re := regexp.MustCompile(`(?s)/` + key + `\s*(/[^\s/>\]]+|\d+\s+\d+\s+R|<<.*?>>|\[.*?\])`)
+		if m := re.FindStringSubmatchIndex(dict); m != nil {
+			end := m[1]
+			if dict[m[2]] == '<' {
+				// the lazy <<.*?>> stops at the first ">>"; extend the match
+				// to the ">>" that closes this (possibly nested) dictionary.
+				depth := 0
+				for i := m[2]; i+1 < len(dict); i++ {
+					if tok := dict[i : i+2]; tok == "<<" {
+						depth++
+						i++
+					} else if tok == ">>" {
+						depth--
+						i++
+						if depth == 0 {
+							end = i + 1
+							break
+						}
+					}
+				}
+			}
+			dict = dict[:m[0]] + "/" + key + " " + value + dict[end:]
+		} else {
+			dict += " /" + key + " " + value
+		}
+	}
+
+	return "<<" + dict + ">>", nil
+}
+
+// patchDocument appends a single incremental-update revision to data: it
+// writes extraObjects as new indirect objects and merges catalogEntries into
+// the existing /Catalog dictionary, without touching anything else in the
+// document. It only supports classic (non cross-reference-stream) PDFs.
+func patchDocument(data []byte, extraObjects map[int]string, catalogEntries map[string]string) ([]byte, error) {
+	trailer, err := parseTrailer(data)
+	if err != nil {
+		return nil, err
+	}
+
+	newObjects := map[int]string{}
+	for n, body := range extraObjects {
+		newObjects[n] = body
+	}
+
+	if len(catalogEntries) > 0 {
+		start, end, err := findObject(data, trailer.rootNum)
+		if err != nil {
+			return nil, err
+		}
+		patched, err := mergeDictEntries(data[start:end], catalogEntries)
+		if err != nil {
+			return nil, err
+		}
+		newObjects[trailer.rootNum] = patched
+	}
+
+	return appendIncrementalUpdate(data, trailer, newObjects, trailer.rootNum), nil
+}
+
+// appendIncrementalUpdate appends a new PDF revision to data that writes
+// newObjects (object numbers may reuse existing ones, which supersedes the
+// prior revision, or be new) and points the new trailer's /Root at
+// newRootNum.
+func appendIncrementalUpdate(data []byte, trailer *pdfTrailer, newObjects map[int]string, newRootNum int) []byte {
+	buf := bytes.NewBuffer(data)
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(newObjects))
+	for n := range newObjects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	size := trailer.size
+	if newRootNum+1 > size {
+		size = newRootNum + 1
+	}
+
+	offsets := make(map[int]int, len(nums))
+	for _, n := range nums {
+		if n+1 > size {
+			size = n + 1
+		}
+		offsets[n] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", n, newObjects[n])
+	}
+
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n")
+	for _, n := range nums {
+		fmt.Fprintf(buf, "%d 1\n%010d 00000 n \n", n, offsets[n])
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root %d 0 R /Prev %d >>\n", size, newRootNum, trailer.startxref)
+	fmt.Fprintf(buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	return buf.Bytes()
+}
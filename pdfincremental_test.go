@@ -0,0 +1,183 @@
+package wkhtmltopdf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fontStreamWithDecoys returns a binary FontFile2-like payload that
+// deliberately contains byte sequences matching "N 0 obj" and "endobj", the
+// exact tokens findObjectBounds looks for. Real wkhtmltopdf output routinely
+// embeds fonts this way, and TrueType tables are just as capable of
+// producing these collisions by accident.
+func fontStreamWithDecoys(catalogNum int) []byte {
+	var b []byte
+	b = append(b, 0x00, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x80, 0x00, 0x03)
+	b = append(b, []byte("\x00some binary glyf table junk ")...)
+	b = append(b, []byte(fmt.Sprintf("%d 0 obj\n<< /Fake true >>\nendobj\n", catalogNum))...)
+	b = append(b, []byte("more binary cmap/loca junk with endobj inside it")...)
+	return b
+}
+
+// buildPDFWithFontStream returns a minimal classic PDF with one page whose
+// resources reference a binary FontFile2 stream object, plus an outline
+// entry if withOutline is set. The font stream's payload contains decoy
+// "N 0 obj"/"endobj" byte sequences (see fontStreamWithDecoys) so tests can
+// assert that object scanning isn't fooled by them. Object numbers are
+// fixed: 1 is the font stream, 4 the page, 5 the page tree root, 6 the
+// catalog (the object most callers look up via patchDocument/findObject),
+// 7/8 the outline root and its single item when withOutline is true.
+func buildPDFWithFontStream(withOutline bool) ([]byte, error) {
+	payload := fontStreamWithDecoys(6)
+	content := "BT /F1 12 Tf ET"
+
+	objects := map[int]string{
+		1: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(payload), payload),
+		2: "<< /Type /FontDescriptor /FontFile2 1 0 R >>",
+		3: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		4: "<< /Type /Page /Parent 5 0 R /Resources << /Font << /F1 2 0 R >> >> /Contents 3 0 R >>",
+		5: "<< /Type /Pages /Kids [4 0 R] /Count 1 >>",
+		6: "<< /Type /Catalog /Pages 5 0 R >>",
+	}
+
+	if withOutline {
+		objects[6] = "<< /Type /Catalog /Pages 5 0 R /Outlines 7 0 R >>"
+		objects[7] = "<< /Type /Outlines /First 8 0 R /Last 8 0 R /Count 1 >>"
+		objects[8] = "<< /Title (Chapter 1) /Parent 7 0 R >>"
+	}
+
+	return buildPDF(objects, 6)
+}
+
+// fontStreamWithIndirectRefDecoy returns a binary FontFile2-like payload
+// that, unlike fontStreamWithDecoys, contains a byte sequence shaped like an
+// indirect reference ("N 0 R") rather than an "obj"/"endobj" pair. This is
+// what renumberRefs must treat as opaque: a regex substitution run over raw
+// stream bytes would renumber it right along with the document's real
+// references.
+func fontStreamWithIndirectRefDecoy() []byte {
+	var b []byte
+	b = append(b, 0x00, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x80, 0x00, 0x03)
+	b = append(b, []byte("\x00glyf table junk ")...)
+	b = append(b, []byte("12 0 R")...)
+	b = append(b, []byte(" more binary cmap/loca junk")...)
+	return b
+}
+
+// buildPDFWithIndirectRefInStream returns a minimal classic PDF whose font
+// stream payload contains a decoy indirect reference (see
+// fontStreamWithIndirectRefDecoy), so a merge can assert that renumberRefs
+// leaves the stream bytes untouched even when every real reference in the
+// document is renumbered.
+func buildPDFWithIndirectRefInStream() ([]byte, error) {
+	payload := fontStreamWithIndirectRefDecoy()
+	content := "BT /F1 12 Tf ET"
+
+	objects := map[int]string{
+		1: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(payload), payload),
+		2: "<< /Type /FontDescriptor /FontFile2 1 0 R >>",
+		3: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		4: "<< /Type /Page /Parent 5 0 R /Resources << /Font << /F1 2 0 R >> >> /Contents 3 0 R >>",
+		5: "<< /Type /Pages /Kids [4 0 R] /Count 1 >>",
+		6: "<< /Type /Catalog /Pages 5 0 R >>",
+	}
+
+	return buildPDF(objects, 6)
+}
+
+// TestFindObjectSkipsBinaryStreamContent ensures findObject locates the real
+// catalog object even when an earlier binary stream object contains byte
+// sequences that look like "6 0 obj"/"endobj".
+func TestFindObjectSkipsBinaryStreamContent(t *testing.T) {
+	data, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start, end, err := findObject(data, 6)
+	if err != nil {
+		t.Fatalf("findObject: %v", err)
+	}
+
+	obj := string(data[start:end])
+	if !strings.Contains(obj, "/Type /Catalog") {
+		t.Fatalf("findObject returned the wrong object, got: %q", obj)
+	}
+	if strings.Contains(obj, "/Fake true") {
+		t.Fatalf("findObject matched the decoy object inside the font stream: %q", obj)
+	}
+}
+
+// TestPatchDocumentSkipsBinaryStreamContent exercises patchDocument (via the
+// same lookup findObject does) end to end: it must patch the real catalog,
+// not a decoy match inside the preceding binary font stream.
+func TestPatchDocumentSkipsBinaryStreamContent(t *testing.T) {
+	data, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := patchDocument(data, nil, map[string]string{"PageLayout": "/OneColumn"})
+	if err != nil {
+		t.Fatalf("patchDocument: %v", err)
+	}
+
+	start, end, err := findObject(patched, 6)
+	if err != nil {
+		t.Fatalf("findObject on patched document: %v", err)
+	}
+
+	obj := string(patched[start:end])
+	if !strings.Contains(obj, "/PageLayout /OneColumn") {
+		t.Fatalf("patched catalog missing /PageLayout entry: %q", obj)
+	}
+	if !strings.Contains(obj, "/Type /Catalog") {
+		t.Fatalf("patched object is not the catalog: %q", obj)
+	}
+}
+
+// TestParseTrailerUsesMostRecentTrailer ensures parseTrailer, run on a
+// document that already has one incremental update appended, reports the
+// new trailer's /Size rather than the original, now-stale one: a plain
+// FindSubmatch over the whole buffer would return the first "trailer<<...>>"
+// block it finds, which is the one the prior patchDocument call left behind.
+func TestParseTrailerUsesMostRecentTrailer(t *testing.T) {
+	data, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origTrailer, err := parseTrailer(data)
+	if err != nil {
+		t.Fatalf("parseTrailer on original document: %v", err)
+	}
+
+	patched, err := patchDocument(data, map[int]string{100: "<< /Type /Dummy >>"}, nil)
+	if err != nil {
+		t.Fatalf("patchDocument: %v", err)
+	}
+
+	patchedTrailer, err := parseTrailer(patched)
+	if err != nil {
+		t.Fatalf("parseTrailer on patched document: %v", err)
+	}
+	if patchedTrailer.size <= origTrailer.size {
+		t.Fatalf("expected patched trailer /Size to grow past %d, got %d", origTrailer.size, patchedTrailer.size)
+	}
+
+	// A second patch must see the updated size, not the original one - that
+	// is exactly the scenario (a second post-processor allocating object
+	// numbers from trailer.size) the review comment called out.
+	twicePatched, err := patchDocument(patched, map[int]string{200: "<< /Type /Dummy2 >>"}, nil)
+	if err != nil {
+		t.Fatalf("second patchDocument: %v", err)
+	}
+	twiceTrailer, err := parseTrailer(twicePatched)
+	if err != nil {
+		t.Fatalf("parseTrailer on twice-patched document: %v", err)
+	}
+	if twiceTrailer.size <= patchedTrailer.size {
+		t.Fatalf("expected twice-patched trailer /Size to grow past %d, got %d", patchedTrailer.size, twiceTrailer.size)
+	}
+}
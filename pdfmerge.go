@@ -0,0 +1,418 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type attachFilesProcessor struct {
+	files []string
+}
+
+// reEmbeddedFilesNames captures the contents of an existing catalog's
+// /Names /EmbeddedFiles /Names array, so a later AttachFiles call can merge
+// into it instead of overwriting it.
+var reEmbeddedFilesNames = regexp.MustCompile(`(?s)/EmbeddedFiles\s*<<\s*/Names\s*\[(.*?)\]`)
+
+// AttachFiles returns a PDFPostProcessor that embeds the given local files
+// into the PDF as file attachments (shown by viewers as paperclip/attachment
+// entries), listed under the document's /Names /EmbeddedFiles name tree.
+func AttachFiles(files []string) PDFPostProcessor {
+	return &attachFilesProcessor{files: files}
+}
+
+func (p *attachFilesProcessor) Process(in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	trailer, err := parseTrailer(data)
+	if err != nil {
+		return err
+	}
+
+	nextNum := trailer.size
+	extraObjects := map[int]string{}
+	var fileSpecs []string
+	for _, path := range p.files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		streamNum := nextNum
+		nextNum++
+		extraObjects[streamNum] = fmt.Sprintf("<< /Type /EmbeddedFile /Length %d >>\nstream\n%s\nendstream", len(content), content)
+
+		specNum := nextNum
+		nextNum++
+		name := filepath.Base(path)
+		extraObjects[specNum] = fmt.Sprintf("<< /Type /Filespec /F (%s) /UF (%s) /EF << /F %d 0 R >> >>", name, name, streamNum)
+
+		fileSpecs = append(fileSpecs, fmt.Sprintf("(%s) %d 0 R", name, specNum))
+	}
+
+	// AddPostProcessor runs processors in a chain, each seeing the previous
+	// one's output, so a second AttachFiles call must extend the existing
+	// /Names /EmbeddedFiles tree rather than replacing it - otherwise the
+	// first call's attachments are orphaned (still in the file, but no
+	// longer listed anywhere a viewer looks).
+	if start, end, err := findObject(data, trailer.rootNum); err == nil {
+		if em := reEmbeddedFilesNames.FindSubmatch(data[start:end]); em != nil {
+			if existing := strings.TrimSpace(string(em[1])); existing != "" {
+				fileSpecs = append([]string{existing}, fileSpecs...)
+			}
+		}
+	}
+
+	namesEntry := fmt.Sprintf("<< /EmbeddedFiles << /Names [%s] >> >>", strings.Join(fileSpecs, " "))
+	patched, err := patchDocument(data, extraObjects, map[string]string{"Names": namesEntry})
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(patched)
+	return err
+}
+
+type mergeProcessor struct {
+	before []io.Reader
+	after  []io.Reader
+}
+
+// MergeBefore returns a PDFPostProcessor that prepends the given PDF
+// documents (e.g. a cover produced by another tool) to the generated PDF.
+func MergeBefore(readers []io.Reader) PDFPostProcessor {
+	return &mergeProcessor{before: readers}
+}
+
+// MergeAfter returns a PDFPostProcessor that appends the given PDF documents
+// (e.g. an appendix wkhtmltopdf can't render well) to the generated PDF.
+func MergeAfter(readers []io.Reader) PDFPostProcessor {
+	return &mergeProcessor{after: readers}
+}
+
+func (p *mergeProcessor) Process(in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	var docs [][]byte
+	for _, r := range p.before {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, b)
+	}
+	docs = append(docs, data)
+	for _, r := range p.after {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, b)
+	}
+
+	merged, err := mergePDFs(docs)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(merged)
+	return err
+}
+
+var (
+	rePagesEntry    = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	reKidsEntry     = regexp.MustCompile(`(?s)/Kids\s*\[(.*?)\]`)
+	reIndirRef      = regexp.MustCompile(`(\d+)\s+(\d+)\s+R`)
+	reParentRef     = regexp.MustCompile(`/Parent\s+\d+\s+\d+\s+R`)
+	reIsPages       = regexp.MustCompile(`/Type\s*/Pages\b`)
+	reOutlinesEntry = regexp.MustCompile(`/Outlines\s+(\d+)\s+\d+\s+R`)
+	reFirstEntry    = regexp.MustCompile(`/First\s+(\d+)\s+\d+\s+R`)
+	reLastEntry     = regexp.MustCompile(`/Last\s+(\d+)\s+\d+\s+R`)
+	reNextEntry     = regexp.MustCompile(`/Next\s+(\d+)\s+\d+\s+R`)
+	reCountEntry    = regexp.MustCompile(`/Count\s+(-?\d+)`)
+)
+
+// outlineChain describes one document's top-level outline (bookmark) items,
+// as a singly-linked /First../Last chain, after renumbering.
+type outlineChain struct {
+	first, last int
+	count       int
+}
+
+// setObjDictEntry adds or overwrites an entry in body, the raw "<< ... >>"
+// content of an object as stored in mergePDFs' object table.
+func setObjDictEntry(body, key, value string) string {
+	re := regexp.MustCompile(`(?s)/` + key + `\s*(/[^\s/>\]]+|\d+\s+\d+\s+R|<<.*?>>|\[.*?\])`)
+	if re.MatchString(body) {
+		return re.ReplaceAllString(body, "/"+key+" "+value)
+	}
+	idx := strings.Index(body, "<<")
+	if idx < 0 {
+		return body + " /" + key + " " + value
+	}
+	return body[:idx+2] + " /" + key + " " + value + body[idx+2:]
+}
+
+// reparentOutlineChain walks a document's top-level outline items from
+// first to last via their /Next links and re-points each one's /Parent at
+// newParent. It is bounded to guard against a malformed /Next cycle.
+func reparentOutlineChain(objects map[int]string, first, last, newParent int) {
+	cur := first
+	for i := 0; i < 100000; i++ {
+		body, ok := objects[cur]
+		if !ok {
+			return
+		}
+		objects[cur] = setObjDictEntry(body, "Parent", fmt.Sprintf("%d 0 R", newParent))
+		if cur == last {
+			return
+		}
+		nm := reNextEntry.FindStringSubmatch(objects[cur])
+		if nm == nil {
+			return
+		}
+		cur, _ = strconv.Atoi(nm[1])
+	}
+}
+
+// parsePDFObjects returns every indirect object in data, keyed by object
+// number, with the "N G obj"/"endobj" wrapper stripped. See
+// findObjectBounds for why this is stream-aware rather than a plain regexp
+// scan over the raw bytes.
+func parsePDFObjects(data []byte) map[int]string {
+	bounds := findObjectBounds(data)
+	objects := make(map[int]string, len(bounds))
+	for num, r := range bounds {
+		objects[num] = string(bytes.TrimSpace(data[r.body[0]:r.body[1]]))
+	}
+	return objects
+}
+
+// collectPageRefs walks a /Pages node of a page tree depth-first and returns
+// the object numbers of every leaf /Page it finds, in document order.
+func collectPageRefs(objects map[int]string, num int, seen map[int]bool) ([]int, error) {
+	if seen[num] {
+		return nil, fmt.Errorf("wkhtmltopdf: cyclic page tree at object %d", num)
+	}
+	seen[num] = true
+
+	obj, ok := objects[num]
+	if !ok {
+		return nil, fmt.Errorf("wkhtmltopdf: object %d not found while walking page tree", num)
+	}
+
+	if !reIsPages.MatchString(obj) {
+		return []int{num}, nil
+	}
+
+	km := reKidsEntry.FindStringSubmatch(obj)
+	if km == nil {
+		return nil, fmt.Errorf("wkhtmltopdf: /Pages object %d has no /Kids", num)
+	}
+
+	var pages []int
+	for _, rm := range reIndirRef.FindAllStringSubmatch(km[1], -1) {
+		kidNum, _ := strconv.Atoi(rm[1])
+		kidPages, err := collectPageRefs(objects, kidNum, seen)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, kidPages...)
+	}
+	return pages, nil
+}
+
+// renumberRefs rewrites every "N G R" indirect reference in obj by adding
+// offset to N. obj may have a stream (everything from its "stream" keyword
+// onward); those bytes are left untouched, the same way findObjectBounds
+// never looks for object boundaries inside a stream, because a binary
+// payload (an embedded font, say) can just as easily contain bytes that
+// happen to look like an indirect reference.
+func renumberRefs(obj string, offset int) string {
+	if offset == 0 {
+		return obj
+	}
+	dict, stream := obj, ""
+	if sm := reStreamKw.FindStringIndex(obj); sm != nil {
+		dict, stream = obj[:sm[0]], obj[sm[0]:]
+	}
+	dict = reIndirRef.ReplaceAllStringFunc(dict, func(m string) string {
+		sm := reIndirRef.FindStringSubmatch(m)
+		n, _ := strconv.Atoi(sm[1])
+		return fmt.Sprintf("%d %s R", n+offset, sm[2])
+	})
+	return dict + stream
+}
+
+// mergePDFs concatenates the page sequences of multiple classic PDF
+// documents (as produced by wkhtmltopdf) into a single document. Every
+// object of each document after the first is renumbered so object numbers
+// never collide, then a single page tree, catalog and trailer are rebuilt
+// around the result, preserving each page's content and resources as-is.
+//
+// mergePDFs does not support encrypted documents, PDFs using
+// cross-reference streams/compressed object streams, or nested outlines; for
+// those, post-process with a fuller library such as pdfcpu instead.
+func mergePDFs(docs [][]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("wkhtmltopdf: no documents to merge")
+	}
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+
+	mergedObjects := map[int]string{}
+	var allPageRefs []int
+	var outlines []outlineChain
+	nextNum := 1
+
+	for _, data := range docs {
+		trailer, err := parseTrailer(data)
+		if err != nil {
+			return nil, err
+		}
+		objects := parsePDFObjects(data)
+
+		offset := nextNum - 1
+
+		rootObj, ok := objects[trailer.rootNum]
+		if !ok {
+			return nil, fmt.Errorf("wkhtmltopdf: catalog object %d not found", trailer.rootNum)
+		}
+		pm := rePagesEntry.FindStringSubmatch(rootObj)
+		if pm == nil {
+			return nil, fmt.Errorf("wkhtmltopdf: catalog has no /Pages entry")
+		}
+		pagesNum, _ := strconv.Atoi(pm[1])
+
+		pageRefs, err := collectPageRefs(objects, pagesNum, map[int]bool{})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pageRefs {
+			allPageRefs = append(allPageRefs, p+offset)
+		}
+
+		if om := reOutlinesEntry.FindStringSubmatch(rootObj); om != nil {
+			outlinesRootNum, _ := strconv.Atoi(om[1])
+			if body, ok := objects[outlinesRootNum]; ok {
+				fm := reFirstEntry.FindStringSubmatch(body)
+				lm := reLastEntry.FindStringSubmatch(body)
+				if fm != nil && lm != nil {
+					firstNum, _ := strconv.Atoi(fm[1])
+					lastNum, _ := strconv.Atoi(lm[1])
+					count := 0
+					if cm := reCountEntry.FindStringSubmatch(body); cm != nil {
+						count, _ = strconv.Atoi(cm[1])
+						if count < 0 {
+							count = -count
+						}
+					}
+					outlines = append(outlines, outlineChain{first: firstNum + offset, last: lastNum + offset, count: count})
+				}
+			}
+		}
+
+		maxNum := 0
+		for n, body := range objects {
+			mergedObjects[n+offset] = renumberRefs(body, offset)
+			if n > maxNum {
+				maxNum = n
+			}
+		}
+
+		nextNum += maxNum
+	}
+
+	pagesNum := nextNum
+	nextNum++
+
+	for _, p := range allPageRefs {
+		mergedObjects[p] = reParentRef.ReplaceAllString(mergedObjects[p], fmt.Sprintf("/Parent %d 0 R", pagesNum))
+	}
+
+	kids := make([]string, len(allPageRefs))
+	for i, p := range allPageRefs {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	mergedObjects[pagesNum] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	catalogEntries := fmt.Sprintf("/Pages %d 0 R", pagesNum)
+
+	// Stitch every document's top-level outline items into one chain, so
+	// the merged document keeps a single, coherent bookmark tree instead of
+	// one /Outlines root per source document (which only the first would
+	// ever be linked from the catalog).
+	if len(outlines) > 0 {
+		for i, o := range outlines {
+			if i > 0 {
+				mergedObjects[o.first] = setObjDictEntry(mergedObjects[o.first], "Prev", fmt.Sprintf("%d 0 R", outlines[i-1].last))
+			}
+			if i < len(outlines)-1 {
+				mergedObjects[o.last] = setObjDictEntry(mergedObjects[o.last], "Next", fmt.Sprintf("%d 0 R", outlines[i+1].first))
+			}
+		}
+
+		outlinesNum := nextNum
+		nextNum++
+
+		totalCount := 0
+		for _, o := range outlines {
+			totalCount += o.count
+			reparentOutlineChain(mergedObjects, o.first, o.last, outlinesNum)
+		}
+
+		mergedObjects[outlinesNum] = fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+			outlines[0].first, outlines[len(outlines)-1].last, totalCount)
+		catalogEntries += fmt.Sprintf(" /Outlines %d 0 R", outlinesNum)
+	}
+
+	catalogNum := nextNum
+	mergedObjects[catalogNum] = "<< /Type /Catalog " + catalogEntries + " >>"
+
+	return buildPDF(mergedObjects, catalogNum)
+}
+
+// buildPDF serializes a full object table into a new, self-contained
+// classic PDF document.
+func buildPDF(objects map[int]string, rootNum int) ([]byte, error) {
+	nums := make([]int, 0, len(objects))
+	for n := range objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make(map[int]int, len(nums))
+	for _, n := range nums {
+		offsets[n] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", n, objects[n])
+	}
+
+	xrefOffset := buf.Len()
+	size := nums[len(nums)-1] + 1
+
+	buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, n := range nums {
+		fmt.Fprintf(buf, "%d 1\n%010d 00000 n \n", n, offsets[n])
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root %d 0 R >>\n", size, rootNum)
+	fmt.Fprintf(buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	return buf.Bytes(), nil
+}
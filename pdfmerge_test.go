@@ -0,0 +1,121 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMergePDFsWithFontStreams merges two documents built by
+// buildPDFWithFontStream, each with an embedded binary font stream (see
+// pdfincremental_test.go) and an outline entry, and checks that the merge
+// produces the expected page count and a single coherent outline chain
+// rather than silently corrupting on the binary payloads.
+func TestMergePDFsWithFontStreams(t *testing.T) {
+	doc1, err := buildPDFWithFontStream(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc2, err := buildPDFWithFontStream(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := mergePDFs([][]byte{doc1, doc2})
+	if err != nil {
+		t.Fatalf("mergePDFs: %v", err)
+	}
+
+	trailer, err := parseTrailer(merged)
+	if err != nil {
+		t.Fatalf("parseTrailer on merged document: %v", err)
+	}
+
+	objects := parsePDFObjects(merged)
+
+	rootObj, ok := objects[trailer.rootNum]
+	if !ok {
+		t.Fatalf("merged catalog object %d not found", trailer.rootNum)
+	}
+
+	pm := rePagesEntry.FindStringSubmatch(rootObj)
+	if pm == nil {
+		t.Fatalf("merged catalog has no /Pages entry: %q", rootObj)
+	}
+	pagesNum, _ := strconv.Atoi(pm[1])
+
+	pageRefs, err := collectPageRefs(objects, pagesNum, map[int]bool{})
+	if err != nil {
+		t.Fatalf("collectPageRefs: %v", err)
+	}
+	if len(pageRefs) != 2 {
+		t.Fatalf("expected 2 pages in merged document, got %d", len(pageRefs))
+	}
+
+	om := reOutlinesEntry.FindStringSubmatch(rootObj)
+	if om == nil {
+		t.Fatalf("merged catalog has no /Outlines entry: %q", rootObj)
+	}
+	outlinesNum, _ := strconv.Atoi(om[1])
+
+	outlinesObj, ok := objects[outlinesNum]
+	if !ok {
+		t.Fatalf("merged outlines object %d not found", outlinesNum)
+	}
+	if cm := reCountEntry.FindStringSubmatch(outlinesObj); cm == nil || cm[1] != "2" {
+		t.Errorf("expected merged outline /Count 2, got object: %q", outlinesObj)
+	}
+
+	fm := reFirstEntry.FindStringSubmatch(outlinesObj)
+	lm := reLastEntry.FindStringSubmatch(outlinesObj)
+	if fm == nil || lm == nil {
+		t.Fatalf("merged outlines object missing /First or /Last: %q", outlinesObj)
+	}
+	firstNum, _ := strconv.Atoi(fm[1])
+	lastNum, _ := strconv.Atoi(lm[1])
+	if firstNum == lastNum {
+		t.Fatalf("expected two distinct outline items, /First and /Last are both %d", firstNum)
+	}
+
+	firstItem, ok := objects[firstNum]
+	if !ok {
+		t.Fatalf("outline item %d not found", firstNum)
+	}
+	if !strings.Contains(firstItem, "/Next") {
+		t.Errorf("first outline item should link to the second via /Next: %q", firstItem)
+	}
+	nm := reNextEntry.FindStringSubmatch(firstItem)
+	if nm == nil {
+		t.Fatalf("first outline item has no /Next entry: %q", firstItem)
+	}
+	if nextNum, _ := strconv.Atoi(nm[1]); nextNum != lastNum {
+		t.Errorf("first outline item's /Next (%d) should point at the last item (%d)", nextNum, lastNum)
+	}
+}
+
+// TestMergePDFsDoesNotRenumberStreamBytes merges a document with a decoy
+// "N 0 R"-shaped byte sequence in a binary font stream (see
+// fontStreamWithIndirectRefDecoy) as the second, renumbered document, and
+// asserts the stream bytes come out unchanged: renumberRefs must not run its
+// reference-rewriting regex over stream payloads, only over the object's
+// dictionary.
+func TestMergePDFsDoesNotRenumberStreamBytes(t *testing.T) {
+	doc1, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc2, err := buildPDFWithIndirectRefInStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := mergePDFs([][]byte{doc1, doc2})
+	if err != nil {
+		t.Fatalf("mergePDFs: %v", err)
+	}
+
+	if !bytes.Contains(merged, fontStreamWithIndirectRefDecoy()) {
+		t.Fatalf("merged document corrupted the font stream's decoy indirect reference, expected exact bytes %q to survive untouched", fontStreamWithIndirectRefDecoy())
+	}
+}
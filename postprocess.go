@@ -0,0 +1,136 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// PDFPostProcessor is implemented by types that transform a finished PDF
+// document. Processors registered on a PDFGenerator via AddPostProcessor run
+// in the order they were added, each receiving the output of the previous
+// one (or the raw wkhtmltopdf output for the first processor).
+type PDFPostProcessor interface {
+	// Process reads a complete PDF document from in and writes the
+	// transformed document to out.
+	Process(in io.Reader, out io.Writer) error
+}
+
+// AddPostProcessor registers a PDFPostProcessor that runs on the generated
+// PDF after wkhtmltopdf has finished writing it. Processors run in the order
+// they were added, and run whether the result ends up in the internal
+// buffer or in OutputFile.
+func (pdfg *PDFGenerator) AddPostProcessor(p PDFPostProcessor) {
+	pdfg.postProcessors = append(pdfg.postProcessors, p)
+}
+
+// runPostProcessors feeds the generated PDF through every registered
+// PDFPostProcessor in order and stores the result back where it came from
+// (the internal buffer, or OutputFile).
+func (pdfg *PDFGenerator) runPostProcessors() error {
+	if len(pdfg.postProcessors) == 0 {
+		return nil
+	}
+
+	var data []byte
+	var err error
+	if pdfg.OutputFile != "" {
+		data, err = ioutil.ReadFile(pdfg.OutputFile)
+	} else {
+		data = pdfg.outbuf.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pdfg.postProcessors {
+		out := &bytes.Buffer{}
+		if err := p.Process(bytes.NewReader(data), out); err != nil {
+			return err
+		}
+		data = out.Bytes()
+	}
+
+	if pdfg.OutputFile != "" {
+		return ioutil.WriteFile(pdfg.OutputFile, data, 0666)
+	}
+	pdfg.outbuf.Reset()
+	pdfg.outbuf.Write(data)
+	return nil
+}
+
+// PageLayout is a value for a PDF document's /PageLayout catalog entry,
+// controlling how a compliant viewer arranges pages when the document is
+// first opened.
+type PageLayout string
+
+// Known PageLayout values, as defined by the PDF specification.
+const (
+	PageLayoutSinglePage     PageLayout = "SinglePage"
+	PageLayoutOneColumn      PageLayout = "OneColumn"
+	PageLayoutTwoColumnLeft  PageLayout = "TwoColumnLeft"
+	PageLayoutTwoColumnRight PageLayout = "TwoColumnRight"
+	PageLayoutTwoPageLeft    PageLayout = "TwoPageLeft"
+	PageLayoutTwoPageRight   PageLayout = "TwoPageRight"
+)
+
+type pageLayoutProcessor struct {
+	layout PageLayout
+}
+
+// SetPageLayout returns a PDFPostProcessor that sets the document's
+// /PageLayout catalog entry.
+func SetPageLayout(layout PageLayout) PDFPostProcessor {
+	return &pageLayoutProcessor{layout: layout}
+}
+
+func (p *pageLayoutProcessor) Process(in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	patched, err := patchDocument(data, nil, map[string]string{"PageLayout": "/" + string(p.layout)})
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(patched)
+	return err
+}
+
+// PageMode is a value for a PDF document's /PageMode catalog entry,
+// controlling how a compliant viewer presents the document window (e.g.
+// whether to show the outline panel or open in full screen).
+type PageMode string
+
+// Known PageMode values, as defined by the PDF specification.
+const (
+	PageModeUseNone        PageMode = "UseNone"
+	PageModeUseOutlines    PageMode = "UseOutlines"
+	PageModeUseThumbs      PageMode = "UseThumbs"
+	PageModeFullScreen     PageMode = "FullScreen"
+	PageModeUseOC          PageMode = "UseOC"
+	PageModeUseAttachments PageMode = "UseAttachments"
+)
+
+type pageModeProcessor struct {
+	mode PageMode
+}
+
+// SetPageMode returns a PDFPostProcessor that sets the document's
+// /PageMode catalog entry.
+func SetPageMode(mode PageMode) PDFPostProcessor {
+	return &pageModeProcessor{mode: mode}
+}
+
+func (p *pageModeProcessor) Process(in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	patched, err := patchDocument(data, nil, map[string]string{"PageMode": "/" + string(p.mode)})
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(patched)
+	return err
+}
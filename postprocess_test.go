@@ -0,0 +1,186 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// orderRecordingProcessor appends its name to a shared log when it runs,
+// so tests can assert AddPostProcessor really runs processors in
+// registration order, each fed the previous one's output.
+type orderRecordingProcessor struct {
+	name string
+	log  *[]string
+}
+
+func (p *orderRecordingProcessor) Process(in io.Reader, out io.Writer) error {
+	*p.log = append(*p.log, p.name)
+	_, err := io.Copy(out, in)
+	return err
+}
+
+// TestRunPostProcessorsOrder ensures processors registered via
+// AddPostProcessor run in registration order against the generator's
+// internal buffer.
+func TestRunPostProcessorsOrder(t *testing.T) {
+	pdfg := NewPDFPreparer()
+	pdfg.outbuf.WriteString("original")
+
+	var log []string
+	pdfg.AddPostProcessor(&orderRecordingProcessor{name: "first", log: &log})
+	pdfg.AddPostProcessor(&orderRecordingProcessor{name: "second", log: &log})
+
+	if err := pdfg.runPostProcessors(); err != nil {
+		t.Fatalf("runPostProcessors: %v", err)
+	}
+
+	if got := strings.Join(log, ","); got != "first,second" {
+		t.Fatalf("expected processors to run in order first,second, got %s", got)
+	}
+	if pdfg.outbuf.String() != "original" {
+		t.Fatalf("expected buffer to survive a chain of pass-through processors unchanged, got %q", pdfg.outbuf.String())
+	}
+}
+
+// TestAttachFilesChainKeepsBothAttachments chains two AttachFiles
+// post-processors through the real AddPostProcessor/runPostProcessors
+// pipeline and checks that both files end up listed in the final /Names
+// /EmbeddedFiles tree - the first call's attachment must not be orphaned by
+// the second.
+func TestAttachFilesChainKeepsBothAttachments(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	if err := ioutil.WriteFile(first, []byte("hello from first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(second, []byte("hello from second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdfg := NewPDFPreparer()
+	pdfg.outbuf.Write(data)
+	pdfg.AddPostProcessor(AttachFiles([]string{first}))
+	pdfg.AddPostProcessor(AttachFiles([]string{second}))
+
+	if err := pdfg.runPostProcessors(); err != nil {
+		t.Fatalf("runPostProcessors: %v", err)
+	}
+
+	out := pdfg.outbuf.Bytes()
+	trailer, err := parseTrailer(out)
+	if err != nil {
+		t.Fatalf("parseTrailer: %v", err)
+	}
+	start, end, err := findObject(out, trailer.rootNum)
+	if err != nil {
+		t.Fatalf("findObject: %v", err)
+	}
+	catalog := string(out[start:end])
+
+	if !strings.Contains(catalog, "first.txt") {
+		t.Errorf("expected catalog /Names tree to still list first.txt after a second AttachFiles call: %q", catalog)
+	}
+	if !strings.Contains(catalog, "second.txt") {
+		t.Errorf("expected catalog /Names tree to list second.txt: %q", catalog)
+	}
+}
+
+// TestMergeBeforeAndAfter exercises MergeBefore and MergeAfter through the
+// real post-processor pipeline, checking that the merged document holds the
+// pages of all three documents (before, generated, after). The three inputs
+// are identical, so the order of the pages is not checked.
+func TestMergeBeforeAndAfter(t *testing.T) {
+	before, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdfg := NewPDFPreparer()
+	pdfg.outbuf.Write(generated)
+	pdfg.AddPostProcessor(MergeBefore([]io.Reader{bytes.NewReader(before)}))
+	pdfg.AddPostProcessor(MergeAfter([]io.Reader{bytes.NewReader(after)}))
+
+	if err := pdfg.runPostProcessors(); err != nil {
+		t.Fatalf("runPostProcessors: %v", err)
+	}
+
+	merged := pdfg.outbuf.Bytes()
+	trailer, err := parseTrailer(merged)
+	if err != nil {
+		t.Fatalf("parseTrailer: %v", err)
+	}
+	objects := parsePDFObjects(merged)
+	rootObj, ok := objects[trailer.rootNum]
+	if !ok {
+		t.Fatalf("merged catalog object %d not found", trailer.rootNum)
+	}
+	pm := rePagesEntry.FindStringSubmatch(rootObj)
+	if pm == nil {
+		t.Fatalf("merged catalog has no /Pages entry: %q", rootObj)
+	}
+	pagesNum, _ := strconv.Atoi(pm[1])
+	pageRefs, err := collectPageRefs(objects, pagesNum, map[int]bool{})
+	if err != nil {
+		t.Fatalf("collectPageRefs: %v", err)
+	}
+	if len(pageRefs) != 3 {
+		t.Fatalf("expected 3 pages (before, generated, after), got %d", len(pageRefs))
+	}
+}
+
+// TestSetPageLayoutAndPageMode exercises SetPageLayout and SetPageMode
+// chained through the real post-processor pipeline, and checks both catalog
+// entries end up set on the final document.
+func TestSetPageLayoutAndPageMode(t *testing.T) {
+	data, err := buildPDFWithFontStream(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdfg := NewPDFPreparer()
+	pdfg.outbuf.Write(data)
+	pdfg.AddPostProcessor(SetPageLayout(PageLayoutTwoColumnLeft))
+	pdfg.AddPostProcessor(SetPageMode(PageModeUseOutlines))
+
+	if err := pdfg.runPostProcessors(); err != nil {
+		t.Fatalf("runPostProcessors: %v", err)
+	}
+
+	out := pdfg.outbuf.Bytes()
+	trailer, err := parseTrailer(out)
+	if err != nil {
+		t.Fatalf("parseTrailer: %v", err)
+	}
+	start, end, err := findObject(out, trailer.rootNum)
+	if err != nil {
+		t.Fatalf("findObject: %v", err)
+	}
+	catalog := string(out[start:end])
+
+	if !strings.Contains(catalog, fmt.Sprintf("/PageLayout /%s", PageLayoutTwoColumnLeft)) {
+		t.Errorf("expected /PageLayout entry in catalog: %q", catalog)
+	}
+	if !strings.Contains(catalog, fmt.Sprintf("/PageMode /%s", PageModeUseOutlines)) {
+		t.Errorf("expected /PageMode entry in catalog: %q", catalog)
+	}
+}
@@ -0,0 +1,138 @@
+package wkhtmltopdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+)
+
+// Renderer is implemented by wkhtmltopdf backends: given the commandline
+// arguments wkhtmltopdf itself would receive and an optional stdin (used for
+// PageReader input), it writes the resulting PDF to stdout and any
+// diagnostic output to stderr. PDFGenerator.SetRenderer swaps the default
+// ExecRenderer for any other implementation.
+type Renderer interface {
+	Render(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// ExecRenderer runs wkhtmltopdf as a local subprocess via os/exec. It is the
+// default Renderer and preserves this package's historical behavior: the
+// binary is located via SetPath/WKHTMLTOPDF_PATH (see initCommand), and
+// SetWrapper/WKHTMLTOPDF_WRAPPER_PATH prefixes it with a wrapper command
+// such as xvfb-run.
+type ExecRenderer struct {
+	// Path is the command to execute, e.g. "/usr/bin/wkhtmltopdf".
+	Path string
+}
+
+// Render implements Renderer.
+func (r *ExecRenderer) Render(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	path := r.Path
+	if wrapper := GetWrapper(); wrapper != "" {
+		args = append([]string{path}, args...)
+		path = wrapper
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// DockerRenderer runs wkhtmltopdf inside a Docker container, so callers
+// don't need the binary (or its native dependencies, such as a working X
+// display) installed on the host. It also sidesteps the xvfb-run wrapper
+// that ExecRenderer relies on for headless rendering.
+type DockerRenderer struct {
+	// Image is the Docker image to run, pinned to a tag that bundles
+	// wkhtmltopdf, e.g. "surnet/alpine-wkhtmltopdf:3.18.2-0.12.6-full".
+	Image string
+	// DockerPath is the path to the docker binary. Defaults to "docker" on PATH.
+	DockerPath string
+	// ExtraArgs are inserted between "docker run" and the image name, e.g.
+	// []string{"--network", "none"}.
+	ExtraArgs []string
+}
+
+// Render implements Renderer.
+func (r *DockerRenderer) Render(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	dockerPath := r.DockerPath
+	if dockerPath == "" {
+		dockerPath = "docker"
+	}
+
+	dockerArgs := append([]string{"run", "--rm", "-i"}, r.ExtraArgs...)
+	dockerArgs = append(dockerArgs, r.Image)
+	dockerArgs = append(dockerArgs, args...)
+
+	cmd := exec.CommandContext(ctx, dockerPath, dockerArgs...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// HTTPRenderer delegates rendering to a remote wkhtmltopdf microservice: it
+// POSTs the commandline arguments and stdin payload to URL and streams the
+// resulting PDF back from the response body. This lets callers run PDF
+// generation as a separate service instead of shelling out locally.
+type HTTPRenderer struct {
+	// URL is the endpoint to POST to, e.g. "http://pdf-service:8080/render".
+	URL string
+	// Client is used to make the request. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// httpRenderRequest is the JSON envelope posted to an HTTPRenderer's URL.
+type httpRenderRequest struct {
+	Args  []string `json:"args"`
+	Stdin []byte   `json:"stdin,omitempty"`
+}
+
+// Render implements Renderer.
+func (r *HTTPRenderer) Render(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var stdinBytes []byte
+	if stdin != nil {
+		var err error
+		stdinBytes, err = ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(httpRenderRequest{Args: args, Stdin: stdinBytes})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := ioutil.ReadAll(resp.Body)
+		fmt.Fprint(stderr, string(errBody))
+		return fmt.Errorf("wkhtmltopdf: http renderer: unexpected status %s", resp.Status)
+	}
+
+	_, err = io.Copy(stdout, resp.Body)
+	return err
+}
@@ -0,0 +1,30 @@
+package wkhtmltopdf
+
+// Section is one independently-configured part of a multi-section document.
+// wkhtmltopdf only accepts a single set of global options per invocation, so
+// a document that mixes, say, a landscape data table with a portrait
+// narrative can't express both in one PDFGenerator; each Section gets its
+// own global/outline options, cover, TOC and pages, and is rendered through
+// its own wkhtmltopdf invocation. AddSection registers a Section with its
+// parent PDFGenerator, which merges every section's output, in order, into
+// the final document.
+type Section struct {
+	*PDFGenerator
+}
+
+// NewSection returns a new Section with all options created. Like
+// NewPDFPreparer, it does not look for the wkhtmltopdf binary itself: a
+// Section always renders through the Renderer (and, for ExecRenderer, the
+// binPath) of the PDFGenerator it is added to via AddSection, unless
+// SetRenderer is called on the Section directly.
+func NewSection() *Section {
+	return &Section{PDFGenerator: NewPDFPreparer()}
+}
+
+// AddSection adds s as the next section of the document. Sections are
+// rendered as independent wkhtmltopdf invocations and merged, in the order
+// added, into the final output; pdfg's own global options, cover, TOC and
+// pages are ignored once at least one section has been added.
+func (pdfg *PDFGenerator) AddSection(s *Section) {
+	pdfg.sections = append(pdfg.sections, s)
+}
@@ -3,19 +3,20 @@ package wkhtmltopdf
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
-	"log"
 )
 
-//the cached mutexed path as used by findPath()
+// the cached mutexed path as used by findPath()
 type stringStore struct {
 	val string
 	sync.Mutex
@@ -101,7 +102,7 @@ func (pr *PageReader) Args() []string {
 	return pr.PageOptions.Args()
 }
 
-//Reader returns the io.Reader and is part of the page interface
+// Reader returns the io.Reader and is part of the page interface
 func (pr *PageReader) Reader() io.Reader {
 	return pr.Input
 }
@@ -171,9 +172,13 @@ type PDFGenerator struct {
 
 	outbuf bytes.Buffer
 	pages  []page
+
+	postProcessors []PDFPostProcessor
+	renderer       Renderer
+	sections       []*Section
 }
 
-//Args returns the commandline arguments as a string slice
+// Args returns the commandline arguments as a string slice
 func (pdfg *PDFGenerator) Args() []string {
 	args := append([]string{}, pdfg.globalOptions.Args()...)
 	args = append(args, pdfg.outlineOptions.Args()...)
@@ -265,26 +270,43 @@ func (pdfg *PDFGenerator) findCommandPath(command string, env string) (string, e
 
 // Create creates the PDF document and stores it in the internal buffer if no error is returned
 func (pdfg *PDFGenerator) Create() error {
-	return pdfg.run()
+	return pdfg.CreateContext(context.Background())
 }
 
-func (pdfg *PDFGenerator) run() error {
+// CreateContext creates the PDF document and stores it in the internal buffer
+// if no error is returned. Unlike Create, it ties the wkhtmltopdf invocation
+// to ctx, so a cancelled or expired context kills a hung or long-running
+// process instead of leaking it.
+func (pdfg *PDFGenerator) CreateContext(ctx context.Context) error {
+	return pdfg.run(ctx)
+}
 
-	errbuf := &bytes.Buffer{}
+func (pdfg *PDFGenerator) run(ctx context.Context) error {
+	if len(pdfg.sections) > 0 {
+		return pdfg.runSections(ctx)
+	}
 
-	cmd := exec.Command(pdfg.binPath, pdfg.Args()...)
+	errbuf := &bytes.Buffer{}
 
-	cmd.Stdout = &pdfg.outbuf
-	cmd.Stderr = errbuf
-	//if there is a pageReader page (from Stdin) we set Stdin to that reader
+	//if there is a pageReader page (from Stdin) we pass that reader on as stdin
+	var stdin io.Reader
 	for _, page := range pdfg.pages {
 		if page.Reader() != nil {
-			cmd.Stdin = page.Reader()
+			stdin = page.Reader()
 			break
 		}
 	}
 
-	err := cmd.Run()
+	renderer := pdfg.renderer
+	if renderer == nil {
+		path := pdfg.binPath
+		if path == "" {
+			path = GetPath()
+		}
+		renderer = &ExecRenderer{Path: path}
+	}
+
+	err := renderer.Render(ctx, pdfg.Args(), stdin, &pdfg.outbuf, errbuf)
 	if err != nil {
 		errStr := errbuf.String()
 		if strings.TrimSpace(errStr) == "" {
@@ -292,24 +314,90 @@ func (pdfg *PDFGenerator) run() error {
 		}
 		return errors.New(errStr)
 	}
-	return nil
+
+	return pdfg.runPostProcessors()
 }
 
+// runSections renders each Section added via AddSection as its own
+// wkhtmltopdf invocation (each may use incompatible global options, e.g.
+// page size or orientation, that a single invocation couldn't mix), then
+// merges the resulting PDFs, in order, into pdfg's output.
+func (pdfg *PDFGenerator) runSections(ctx context.Context) error {
+	docs := make([][]byte, 0, len(pdfg.sections))
+	for i, s := range pdfg.sections {
+		if s.renderer == nil {
+			s.renderer = pdfg.renderer
+		}
+		if s.binPath == "" {
+			s.binPath = pdfg.binPath
+		}
+		// each section renders into its own in-memory buffer; the merge
+		// below is what ends up at pdfg.OutputFile, if any.
+		s.OutputFile = ""
+
+		if err := s.CreateContext(ctx); err != nil {
+			return fmt.Errorf("wkhtmltopdf: section %d: %v", i, err)
+		}
+		docs = append(docs, s.Bytes())
+	}
+
+	merged, err := mergePDFs(docs)
+	if err != nil {
+		return err
+	}
+
+	if pdfg.OutputFile != "" {
+		if err := ioutil.WriteFile(pdfg.OutputFile, merged, 0666); err != nil {
+			return err
+		}
+	} else {
+		pdfg.outbuf.Reset()
+		pdfg.outbuf.Write(merged)
+	}
+
+	return pdfg.runPostProcessors()
+}
+
+// SetRenderer overrides how pdfg invokes wkhtmltopdf. By default a
+// PDFGenerator uses an *ExecRenderer pointed at the path found by
+// initCommand/SetPath, i.e. it shells out to a locally installed
+// wkhtmltopdf binary. Call SetRenderer to swap in a DockerRenderer, an
+// HTTPRenderer, or any other Renderer, e.g. to run PDF generation as a
+// sidecar service without installing the binary on this host.
+func (pdfg *PDFGenerator) SetRenderer(r Renderer) {
+	pdfg.renderer = r
+}
+
+// findPathMu serializes the wkhtmltopdf (and xvfb-run wrapper) lookup so
+// that initCommand is safe to call from multiple goroutines constructing
+// generators concurrently. Unlike a sync.Once, it does not cache a failed
+// lookup forever: as long as GetPath() is still empty, the next call retries
+// the lookup from scratch, so a generator created before the binary (or
+// WKHTMLTOPDF_PATH) was in place still succeeds once the environment catches up.
+var findPathMu sync.Mutex
+
 func (pdfg *PDFGenerator) initCommand() error {
 	if GetPath() != "" {
 		pdfg.binPath = GetPath()
 		return nil
 	}
 
+	findPathMu.Lock()
+	defer findPathMu.Unlock()
+
+	// GetPath() may have been set by another goroutine while we were
+	// waiting for the lock.
+	if GetPath() != "" {
+		pdfg.binPath = GetPath()
+		return nil
+	}
+
 	mainPath, err := pdfg.findCommandPath("wkhtmltopdf", "WKHTMLTOPDF_PATH")
 	if err != nil {
 		return err
 	}
 
 	wrapPath, _ := pdfg.findCommandPath("xvfb-run", "WKHTMLTOPDF_WRAPPER_PATH")
-	if err != nil {
-		return err
-	}
 
 	var finalPath = mainPath
 	if wrapPath != "" {
@@ -320,7 +408,6 @@ func (pdfg *PDFGenerator) initCommand() error {
 
 	binPath.Set(finalPath)
 	pdfg.binPath = finalPath
-
 	return nil
 }
 
@@ -341,12 +428,11 @@ func NewPDFGenerator() (*PDFGenerator, error) {
 		},
 	}
 
-	err := pdfg.initCommand()
-	if err != nil {
-		log.Fatal(err)
+	if err := pdfg.initCommand(); err != nil {
+		return nil, err
 	}
 
-	return pdfg, err
+	return pdfg, nil
 }
 
 // NewPDFPreparer returns a PDFGenerator object without looking for the wkhtmltopdf executable file.
@@ -367,4 +453,3 @@ func NewPDFPreparer() *PDFGenerator {
 		},
 	}
 }
-